@@ -1,11 +1,44 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"github.com/boltdb/bolt"
+	"regexp"
+	"time"
 )
 
-func commandAdd(config *Config, url string) error {
+// ErrFeedExists is returned by commandAdd when the feed is already in the
+// database, so callers (e.g. commandImportOPML) can tell that case apart
+// from a hard failure.
+var ErrFeedExists = errors.New("Feed already exists in database")
+
+// FeedOptions holds the per-feed overrides and filters accepted by the "add"
+// command; see FeedMeta for field meaning.
+type FeedOptions struct {
+	Title               string
+	Recipient           string
+	IncludeRegex        string
+	ExcludeRegex        string
+	MinPubAge           time.Duration
+	MaxItemsPerRun      int
+	RewriteTemplatePath string
+	Category            string
+}
+
+func commandAdd(config *Config, url string, opts *FeedOptions) error {
+
+	if opts.IncludeRegex != "" {
+		if _, err := regexp.Compile(opts.IncludeRegex); err != nil {
+			return fmt.Errorf("Invalid include regex (regex: %q): %v", opts.IncludeRegex, err)
+		}
+	}
+
+	if opts.ExcludeRegex != "" {
+		if _, err := regexp.Compile(opts.ExcludeRegex); err != nil {
+			return fmt.Errorf("Invalid exclude regex (regex: %q): %v", opts.ExcludeRegex, err)
+		}
+	}
 
 	db, err := openDatabase(config)
 	if err != nil {
@@ -26,7 +59,7 @@ func commandAdd(config *Config, url string) error {
 		}
 
 		if b1.Bucket([]byte(url)) != nil {
-			return fmt.Errorf("Feed %q already exists in database", url)
+			return fmt.Errorf("Feed %q already exists in database: %w", url, ErrFeedExists)
 		}
 
 		b2, err := b1.CreateBucket([]byte(url))
@@ -38,8 +71,20 @@ func commandAdd(config *Config, url string) error {
 			return err
 		}
 
+		if _, err := b2.CreateBucket([]byte("hash")); err != nil {
+			return err
+		}
+
 		m := &FeedMeta{
-			Link: url,
+			Link:                url,
+			Title:               opts.Title,
+			Recipient:           opts.Recipient,
+			IncludeRegex:        opts.IncludeRegex,
+			ExcludeRegex:        opts.ExcludeRegex,
+			MinPubAge:           opts.MinPubAge,
+			MaxItemsPerRun:      opts.MaxItemsPerRun,
+			RewriteTemplatePath: opts.RewriteTemplatePath,
+			Category:            opts.Category,
 		}
 		v, err := m.toBytes()
 		if err != nil {
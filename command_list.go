@@ -39,6 +39,30 @@ func commandList(config *Config) error {
 			}
 
 			fmt.Printf("%v\n", m.Link)
+			if m.Title != "" {
+				fmt.Printf("  Title: %v\n", m.Title)
+			}
+			if m.Recipient != "" {
+				fmt.Printf("  Recipient: %v\n", m.Recipient)
+			}
+			if m.IncludeRegex != "" {
+				fmt.Printf("  Include: %v\n", m.IncludeRegex)
+			}
+			if m.ExcludeRegex != "" {
+				fmt.Printf("  Exclude: %v\n", m.ExcludeRegex)
+			}
+			if m.MinPubAge != 0 {
+				fmt.Printf("  MinPubAge: %v\n", m.MinPubAge)
+			}
+			if m.MaxItemsPerRun != 0 {
+				fmt.Printf("  MaxItemsPerRun: %v\n", m.MaxItemsPerRun)
+			}
+			if m.RewriteTemplatePath != "" {
+				fmt.Printf("  RewriteTemplate: %v\n", m.RewriteTemplatePath)
+			}
+			if m.Category != "" {
+				fmt.Printf("  Category: %v\n", m.Category)
+			}
 
 			return nil
 		}); err != nil {
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"os"
+	"strings"
+)
+
+// opmlDocument and opmlOutline model just enough of OPML 2.0 to round-trip
+// rss2email's feed list: https://opml.org/spec2.opml
+type opmlDocument struct {
+	XMLName xml.Name     `xml:"opml"`
+	Version string       `xml:"version,attr"`
+	Head    opmlHead     `xml:"head"`
+	Body    opmlOutlines `xml:"body"`
+}
+
+type opmlHead struct {
+	Title string `xml:"title"`
+}
+
+type opmlOutlines struct {
+	Outlines []*opmlOutline `xml:"outline"`
+}
+
+type opmlOutline struct {
+	Text     string         `xml:"text,attr"`
+	Title    string         `xml:"title,attr,omitempty"`
+	Type     string         `xml:"type,attr,omitempty"`
+	XMLURL   string         `xml:"xmlUrl,attr,omitempty"`
+	Outlines []*opmlOutline `xml:"outline"`
+}
+
+// commandImportOPML adds every feed outline found in the OPML document at
+// path, via commandAdd. A nested outline group becomes the feed's Category.
+// Feeds already in the database, and outlines without an xmlUrl, are
+// skipped rather than treated as failures.
+func commandImportOPML(config *Config, path string) error {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("Failed to open OPML file (path: %q): %v", path, err)
+	}
+	defer f.Close()
+
+	var doc opmlDocument
+	if err := xml.NewDecoder(f).Decode(&doc); err != nil {
+		return fmt.Errorf("Failed to parse OPML file (path: %q): %v", path, err)
+	}
+
+	var importOutlines func(outlines []*opmlOutline, category string) error
+	importOutlines = func(outlines []*opmlOutline, category string) error {
+		for _, o := range outlines {
+
+			if o.XMLURL == "" {
+				groupCategory := o.Text
+				if category != "" {
+					groupCategory = category + "/" + o.Text
+				}
+				if err := importOutlines(o.Outlines, groupCategory); err != nil {
+					return err
+				}
+				continue
+			}
+
+			title := o.Title
+			if title == "" {
+				title = o.Text
+			}
+
+			err := commandAdd(config, o.XMLURL, &FeedOptions{
+				Title:    title,
+				Category: category,
+			})
+			if errors.Is(err, ErrFeedExists) {
+				log(LOG_1, "Skip (already in database): %v", o.XMLURL)
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			log(LOG_1, "Import: %v", o.XMLURL)
+		}
+		return nil
+	}
+
+	return importOutlines(doc.Body.Outlines, "")
+}
+
+// groupOutline returns the outline for the given "/"-separated category
+// path under doc.Body, creating and nesting one outline per path segment as
+// needed--so a feed imported under "Tech/Go" round-trips to a Tech outline
+// containing a Go outline, not a single outline literally titled "Tech/Go".
+// categories caches groups by their full path so siblings sharing a prefix
+// (e.g. "Tech/Go" and "Tech/Rust") share the same parent.
+func groupOutline(doc *opmlDocument, categories map[string]*opmlOutline, category string) *opmlOutline {
+
+	siblings := &doc.Body.Outlines
+	prefix := ""
+	var group *opmlOutline
+
+	for _, part := range strings.Split(category, "/") {
+		if prefix != "" {
+			prefix += "/"
+		}
+		prefix += part
+
+		var ok bool
+		group, ok = categories[prefix]
+		if !ok {
+			group = &opmlOutline{Text: part}
+			categories[prefix] = group
+			*siblings = append(*siblings, group)
+		}
+		siblings = &group.Outlines
+	}
+
+	return group
+}
+
+// commandExportOPML writes every feed in the database to path as an OPML
+// 2.0 document, grouping feeds by Category into nested outlines.
+func commandExportOPML(config *Config, path string) error {
+
+	db, err := openDatabase(config)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := db.Close(); err != nil {
+			panic(err)
+		}
+	}()
+
+	doc := opmlDocument{
+		Version: "2.0",
+		Head:    opmlHead{Title: "rss2email feeds"},
+	}
+
+	categories := make(map[string]*opmlOutline)
+
+	if err := db.View(func(tx *bolt.Tx) error {
+
+		b1 := tx.Bucket([]byte("feed"))
+		if b1 == nil {
+			panic("Feed bucket in database does not exist")
+		}
+
+		return b1.ForEach(func(k1, v1 []byte) error {
+
+			b2 := b1.Bucket(k1)
+			if b2 == nil {
+				panic("Feed object is not a bucket")
+			}
+
+			m, err := feedMetaFromBytes(b2.Get([]byte("meta")))
+			if err != nil {
+				return err
+			}
+
+			title := m.Title
+			if title == "" {
+				title = m.Link
+			}
+
+			outline := &opmlOutline{
+				Text:   title,
+				Title:  title,
+				Type:   "rss",
+				XMLURL: m.Link,
+			}
+
+			if m.Category == "" {
+				doc.Body.Outlines = append(doc.Body.Outlines, outline)
+				return nil
+			}
+
+			group := groupOutline(&doc, categories, m.Category)
+			group.Outlines = append(group.Outlines, outline)
+
+			return nil
+		})
+	}); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("Failed to create OPML file (path: %q): %v", path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(xml.Header); err != nil {
+		return fmt.Errorf("Failed to write OPML file (path: %q): %v", path, err)
+	}
+
+	e := xml.NewEncoder(f)
+	e.Indent("", "  ")
+	if err := e.Encode(&doc); err != nil {
+		return fmt.Errorf("Failed to encode OPML file (path: %q): %v", path, err)
+	}
+
+	return nil
+}
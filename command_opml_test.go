@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOPMLImportExportRoundTrip(t *testing.T) {
+
+	tmpdir := mustCreateTempDir()
+	defer mustRemoveTempDir(tmpdir)
+
+	config := &Config{
+		DatabasePath:    filepath.Join(tmpdir, "feeds.db"),
+		DatabaseTimeout: time.Second,
+	}
+
+	db, err := createDatabase(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	opmlPath := filepath.Join(tmpdir, "feeds.opml")
+	opmlContent := `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="2.0">
+<head><title>Test</title></head>
+<body>
+<outline text="Tech">
+<outline text="Example Feed" xmlUrl="http://example.com/feed"/>
+<outline text="Go">
+<outline text="Nested Feed" xmlUrl="http://example.com/nested"/>
+</outline>
+</outline>
+<outline text="Uncategorized Feed" xmlUrl="http://example.com/other"/>
+</body>
+</opml>`
+	if err := ioutil.WriteFile(opmlPath, []byte(opmlContent), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := commandImportOPML(config, opmlPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// Re-importing the same file should skip the now-duplicate feeds
+	// instead of failing.
+	if err := commandImportOPML(config, opmlPath); err != nil {
+		t.Fatal(err)
+	}
+
+	exportPath := filepath.Join(tmpdir, "export.opml")
+	if err := commandExportOPML(config, exportPath); err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err := ioutil.ReadFile(exportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc opmlDocument
+	if err := xml.Unmarshal(exported, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	var group, uncategorized *opmlOutline
+	for _, o := range doc.Body.Outlines {
+		switch o.Text {
+		case "Tech":
+			group = o
+		case "Uncategorized Feed":
+			uncategorized = o
+		}
+	}
+
+	if group == nil {
+		t.Fatal("Expected exported OPML to contain a Tech category group")
+	}
+
+	var feedOutline, subGroup *opmlOutline
+	for _, o := range group.Outlines {
+		switch o.Text {
+		case "Example Feed":
+			feedOutline = o
+		case "Go":
+			subGroup = o
+		}
+	}
+
+	if feedOutline == nil || feedOutline.XMLURL != "http://example.com/feed" {
+		t.Errorf("Expected Tech group to contain the categorized feed, got %+v", group.Outlines)
+	}
+
+	if subGroup == nil {
+		t.Fatalf("Expected Tech group to contain a nested Go outline (not a single \"Tech/Go\" outline), got %+v", group.Outlines)
+	}
+	if len(subGroup.Outlines) != 1 || subGroup.Outlines[0].XMLURL != "http://example.com/nested" {
+		t.Errorf("Expected Go sub-group to contain the nested feed, got %+v", subGroup.Outlines)
+	}
+
+	if uncategorized == nil || uncategorized.XMLURL != "http://example.com/other" {
+		t.Error("Expected exported OPML to contain the uncategorized feed at the top level")
+	}
+}
@@ -1,23 +1,22 @@
 package main
 
 import (
-	"crypto/tls"
+	"bytes"
+	"crypto/sha256"
 	"fmt"
 	"github.com/boltdb/bolt"
 	"github.com/mmcdole/gofeed"
-	"html"
-	"net/smtp"
+	"html/template"
+	"net/http"
+	"regexp"
 	"strings"
 	"sync"
+	texttemplate "text/template"
 	"time"
 )
 
-const NUM_FETCHERS = 20
 const VERBOSITY = LOG_2
 
-const DEBUG_SEND_TEST = false
-const DEBUG_NO_SEND = false
-
 const (
 	LOG_0 = iota
 	LOG_1
@@ -37,110 +36,263 @@ func log(verbosity int, format string, a ...interface{}) {
 	fmt.Println(line)
 }
 
-type mailer struct {
-	client *smtp.Client
-	config *Config
+func itemGUID(item *gofeed.Item) []byte {
+	if 0 < len(item.GUID) {
+		return []byte(item.GUID)
+	}
+	return []byte(item.Link) // fallback--we need something unique
 }
 
-func newMailer(config *Config) (*mailer, error) {
+// itemContentHash hashes the item's normalized title, link and description,
+// so that items which are republished under a new GUID--or whose feed
+// mutates the GUID on every fetch--can still be recognized as already sent.
+func itemContentHash(item *gofeed.Item) []byte {
+	normalized := strings.Join([]string{
+		strings.TrimSpace(item.Title),
+		strings.TrimSpace(item.Link),
+		strings.TrimSpace(item.Description),
+	}, "\x00")
+	sum := sha256.Sum256([]byte(normalized))
+	return sum[:]
+}
 
-	if DEBUG_NO_SEND {
-		return &mailer{}, nil
+func itemPubDate(item *gofeed.Item) time.Time {
+	if item.PublishedParsed != nil {
+		return *item.PublishedParsed
 	}
+	return time.Now()
+}
 
-	c, err := smtp.Dial(config.SmtpServer)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to connect to SMTP server (server: %q): %v", config.SmtpServer, err)
+// isItemSeen reports whether an item has already been recorded, according to
+// config.DedupMode: by GUID, by content hash, or by either.
+func isItemSeen(config *Config, itemBucket, hashBucket *bolt.Bucket, guid, hash []byte) (bool, error) {
+
+	seenByGUID := false
+	if v := itemBucket.Get(guid); v != nil {
+		if _, err := feedItemFromBytes(v); err != nil {
+			return false, err
+		}
+		seenByGUID = true
+	}
+
+	seenByHash := false
+	if config.DedupMode == "hash" || config.DedupMode == "both" {
+		if hashBucket.Get(hash) != nil {
+			seenByHash = true
+		}
+	}
+
+	switch config.DedupMode {
+	case "hash":
+		return seenByHash, nil
+	case "both":
+		return seenByGUID || seenByHash, nil
+	default:
+		return seenByGUID, nil
 	}
+}
+
+func putFeedItem(itemBucket, hashBucket *bolt.Bucket, guid, hash []byte, pubDate time.Time) error {
 
-	tlsConfig := tls.Config{
-		ServerName: strings.Split(config.SmtpServer, ":")[0],
+	f := FeedItem{
+		PubDate:     pubDate,
+		ContentHash: hash,
 	}
 
-	if err := c.StartTLS(&tlsConfig); err != nil {
-		return nil, fmt.Errorf("Failed to start TLS with SMTP server (server: %q): %v",
-			config.SmtpServer, err)
+	v, err := f.toBytes()
+	if err != nil {
+		return err
 	}
 
-	auth := smtp.PlainAuth("", config.SmtpUser, config.SmtpPassword, strings.Split(config.SmtpServer, ":")[0])
+	if err := itemBucket.Put(guid, v); err != nil {
+		return fmt.Errorf("Failed to write feed item to database: %v", err)
+	}
 
-	if err := c.Auth(auth); err != nil {
-		return nil, fmt.Errorf("Failed to authenticate with SMTP server (server: %q, username: %q, password: *****): %v",
-			config.SmtpServer, config.SmtpUser, err)
+	if err := hashBucket.Put(hash, guid); err != nil {
+		return fmt.Errorf("Failed to write feed item hash to database: %v", err)
 	}
 
-	return &mailer{
-		client: c,
-		config: config,
-	}, nil
+	return nil
 }
 
-func (m *mailer) Close() error {
+// sendWithRetry sends an item, retrying with exponential backoff after any
+// send error up to config.SendRetries times. Every attempt uses the same
+// mailer, so a dropped connection is not re-established.
+func sendWithRetry(m mailer, feed *gofeed.Feed, item *gofeed.Item, recipient string, config *Config) error {
+
+	var lastErr error
+	backoff := config.SendBackoff
+
+	for attempt := 0; attempt <= config.SendRetries; attempt++ {
+		if attempt > 0 {
+			log(LOG_1, "Retry %v/%v: %v (%q): %v", attempt, config.SendRetries, feed.Title, item.Title, lastErr)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		if err := m.send(feed, item, recipient); err != nil {
+			lastErr = err
+			continue
+		}
 
-	if DEBUG_NO_SEND {
 		return nil
 	}
 
-	return m.client.Close()
+	return fmt.Errorf("Failed to send item after %v attempts (feed: %q, item: %q): %v",
+		config.SendRetries+1, feed.Title, item.Title, lastErr)
+}
+
+// itemMatchesFeedFilters reports whether an item passes the feed's
+// IncludeRegex/ExcludeRegex filters, matching against the item's title and
+// description.
+func itemMatchesFeedFilters(meta *FeedMeta, item *gofeed.Item) (bool, error) {
+
+	haystack := item.Title + "\n" + item.Description
+
+	if meta.IncludeRegex != "" {
+		re, err := regexp.Compile(meta.IncludeRegex)
+		if err != nil {
+			return false, fmt.Errorf("Invalid include regex (feed: %q, regex: %q): %v", meta.Link, meta.IncludeRegex, err)
+		}
+		if !re.MatchString(haystack) {
+			return false, nil
+		}
+	}
+
+	if meta.ExcludeRegex != "" {
+		re, err := regexp.Compile(meta.ExcludeRegex)
+		if err != nil {
+			return false, fmt.Errorf("Invalid exclude regex (feed: %q, regex: %q): %v", meta.Link, meta.ExcludeRegex, err)
+		}
+		if re.MatchString(haystack) {
+			return false, nil
+		}
+	}
+
+	return true, nil
 }
 
-func (m *mailer) send(feed *gofeed.Feed, item *gofeed.Item) error {
+// rewriteItemBody rewrites item.Description in place by executing the
+// feed's configured text/template against it, if one is configured.
+func rewriteItemBody(meta *FeedMeta, item *gofeed.Item) error {
 
-	if DEBUG_NO_SEND {
+	if meta.RewriteTemplatePath == "" {
 		return nil
 	}
 
-	// Format the message.
-	// FIXME: Need to escape stuff.
+	tmpl, err := texttemplate.ParseFiles(meta.RewriteTemplatePath)
+	if err != nil {
+		return fmt.Errorf("Failed to parse rewrite template (feed: %q, path: %q): %v", meta.Link, meta.RewriteTemplatePath, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, item); err != nil {
+		return fmt.Errorf("Failed to execute rewrite template (feed: %q, path: %q): %v", meta.Link, meta.RewriteTemplatePath, err)
+	}
+
+	item.Description = buf.String()
+	return nil
+}
+
+// fetchResult is the outcome of one fetch attempt against a feed, carried
+// back from a fetcher goroutine to the tx-owning goroutine, which is the
+// only one allowed to persist it into FeedMeta.
+type fetchResult struct {
+	feedLink string
+	feed     *gofeed.Feed // nil unless fetchStatus is "ok"
+
+	etag                string
+	lastModified        string
+	fetchTime           time.Time
+	fetchStatus         string
+	consecutiveFailures int
+
+	err error // set when fetchStatus is "error: ...", for logging
+}
+
+// fetchBackoffDelay returns how long to wait before retrying a feed that has
+// failed consecutiveFailures fetch attempts in a row, doubling the delay
+// each time up to a one-day ceiling.
+func fetchBackoffDelay(consecutiveFailures int) time.Duration {
+	if consecutiveFailures <= 0 {
+		return 0
+	}
+	delay := time.Minute
+	for i := 1; i < consecutiveFailures; i++ {
+		delay *= 2
+		if 24*time.Hour <= delay {
+			return 24 * time.Hour
+		}
+	}
+	return delay
+}
+
+// fetchFeed performs a conditional GET against feedLink, sending
+// If-None-Match/If-Modified-Since from meta's cached values, and reports the
+// new caching metadata to persist regardless of whether the fetch
+// succeeded, found nothing new, or failed.
+func fetchFeed(httpClient *http.Client, userAgent, feedLink string, meta *FeedMeta) *fetchResult {
+
+	result := &fetchResult{
+		feedLink:            feedLink,
+		etag:                meta.ETag,
+		lastModified:        meta.LastModified,
+		fetchTime:           time.Now(),
+		consecutiveFailures: meta.ConsecutiveFailures,
+	}
 
-	var parts []string
-	parts = append(parts, fmt.Sprintf("To: %v", m.config.Recipient))
-	parts = append(parts, fmt.Sprintf("From: %v <%v>", feed.Title, m.config.SmtpUser))
-	text := ""
-	if DEBUG_SEND_TEST {
-		text = "(rss2email-test) "
+	fail := func(err error) *fetchResult {
+		result.err = err
+		result.fetchStatus = fmt.Sprintf("error: %v", err)
+		result.consecutiveFailures = meta.ConsecutiveFailures + 1
+		return result
 	}
-	parts = append(parts, fmt.Sprintf("Subject: %v%v", text, item.Title))
-	parts = append(parts, "Content-Type: text/html")
-	parts = append(parts, "")
-	parts = append(parts, fmt.Sprintf(`<h1><a href="%v">%v</a></h1>%v<p><a href="%v">%v</a></p>`,
-		html.EscapeString(item.Link),
-		html.EscapeString(item.Title),
-		item.Description,
-		html.EscapeString(item.Link),
-		html.EscapeString(item.Link)))
-
-	content := strings.Join(parts, "\r\n")
-
-	if err := m.client.Mail(m.config.SmtpUser); err != nil {
-		return fmt.Errorf("Failed to execute SMTP MAIL command: %v", err)
+
+	req, err := http.NewRequest("GET", feedLink, nil)
+	if err != nil {
+		return fail(err)
 	}
 
-	if err := m.client.Rcpt(m.config.Recipient); err != nil {
-		return fmt.Errorf("Failed to execute SMTP RCTP command: %v", err)
+	req.Header.Set("User-Agent", userAgent)
+	if meta.ETag != "" {
+		req.Header.Set("If-None-Match", meta.ETag)
+	}
+	if meta.LastModified != "" {
+		req.Header.Set("If-Modified-Since", meta.LastModified)
 	}
 
-	w, err := m.client.Data()
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("Failed to execute SMTP DATA command: %v", err)
+		return fail(err)
 	}
+	defer resp.Body.Close()
 
-	if _, err := w.Write([]byte(content)); err != nil {
-		return fmt.Errorf("Failed to write content in SMTP DATA command: %v", err)
+	if resp.StatusCode == http.StatusNotModified {
+		result.fetchStatus = "not-modified"
+		result.consecutiveFailures = 0
+		return result
 	}
 
-	if err := w.Close(); err != nil {
-		return fmt.Errorf("Failed to close SMTP DATA command writer: %v", err)
+	if resp.StatusCode != http.StatusOK {
+		return fail(fmt.Errorf("Unexpected HTTP status (status: %v)", resp.Status))
 	}
 
-	return nil
-}
+	feed, err := gofeed.NewParser().Parse(resp.Body)
+	if err != nil {
+		return fail(err)
+	}
 
-func itemGUID(item *gofeed.Item) []byte {
-	if 0 < len(item.GUID) {
-		return []byte(item.GUID)
+	result.feed = feed
+	result.fetchStatus = "ok"
+	result.consecutiveFailures = 0
+	if v := resp.Header.Get("ETag"); v != "" {
+		result.etag = v
 	}
-	return []byte(item.Link) // fallback--we need something unique
+	if v := resp.Header.Get("Last-Modified"); v != "" {
+		result.lastModified = v
+	}
+
+	return result
 }
 
 func commandRun(config *Config) error {
@@ -156,7 +308,15 @@ func commandRun(config *Config) error {
 		}
 	}()
 
-	return db.Update(func(tx *bolt.Tx) error {
+	// sendFailure holds a send error surfaced from the transaction below,
+	// kept outside of it deliberately: one feed's send failing after all
+	// its retries must not cause boltdb to roll back the whole run's
+	// writes--including every other feed's "seen" records and freshly
+	// fetched ETag/Last-Modified/ConsecutiveFailures--so it's reported only
+	// after the transaction has committed successfully.
+	var sendFailure error
+
+	if err := db.Update(func(tx *bolt.Tx) error {
 
 		// NOTE: Bolt transactions are not thread-safe, hence we must access the
 		// database only from this goroutine.
@@ -168,40 +328,46 @@ func commandRun(config *Config) error {
 
 		// FETCHING
 
-		var feedLinks []string
+		// Feed meta (including the cached ETag/Last-Modified used for the
+		// conditional GET) is read here, on the tx-owning goroutine, since
+		// fetcher goroutines may not touch Bolt.
+
+		type fetchRequest struct {
+			feedLink string
+			meta     *FeedMeta
+		}
+
+		var fetchRequests []*fetchRequest
 		if err := feedBucket.ForEach(func(k, v []byte) error {
 			feedLink := string(k)
-			feedLinks = append(feedLinks, feedLink)
+			b := feedBucket.Bucket(k)
+			meta, err := feedMetaFromBytes(b.Get([]byte("meta")))
+			if err != nil {
+				return fmt.Errorf("Failed to read feed meta (feed: %q): %v", feedLink, err)
+			}
+			fetchRequests = append(fetchRequests, &fetchRequest{feedLink: feedLink, meta: meta})
 			return nil
 		}); err != nil {
 			return err
 		}
 
-		type fetchResult struct {
-			feedLink string
-			feed     *gofeed.Feed
-		}
+		httpClient := &http.Client{Timeout: config.FetchTimeout}
 
 		var fetchGroup sync.WaitGroup
-		fetchInQueue := make(chan string)
+		fetchInQueue := make(chan *fetchRequest)
 		fetchOutQueue := make(chan *fetchResult)
 
-		fetchGroup.Add(NUM_FETCHERS)
-		for i := 0; i < NUM_FETCHERS; i++ {
+		fetchGroup.Add(config.NumFetchers)
+		for i := 0; i < config.NumFetchers; i++ {
 			go func() {
 				defer fetchGroup.Done()
-				for feedLink := range fetchInQueue {
-					log(LOG_1, "Fetch: %v", feedLink)
-					parser := gofeed.NewParser()
-					feed, err := parser.ParseURL(feedLink)
-					if err != nil {
-						log(LOG_0, "*** Failed to fetch %v: %v.", feedLink, err)
+				for req := range fetchInQueue {
+					if delay := fetchBackoffDelay(req.meta.ConsecutiveFailures); 0 < delay && time.Since(req.meta.LastFetchTime) < delay {
+						log(LOG_1, "Back off: %v (failures: %v)", req.feedLink, req.meta.ConsecutiveFailures)
 						continue
 					}
-					fetchOutQueue <- &fetchResult{
-						feedLink: feedLink,
-						feed:     feed,
-					}
+					log(LOG_1, "Fetch: %v", req.feedLink)
+					fetchOutQueue <- fetchFeed(httpClient, config.UserAgent, req.feedLink, req.meta)
 				}
 			}()
 		}
@@ -215,8 +381,8 @@ func commandRun(config *Config) error {
 		// goroutine must be immediately available to receive fetched items.
 
 		go func() {
-			for _, feedLink := range feedLinks {
-				fetchInQueue <- feedLink
+			for _, req := range fetchRequests {
+				fetchInQueue <- req
 			}
 			close(fetchInQueue)
 		}()
@@ -226,8 +392,15 @@ func commandRun(config *Config) error {
 		// Take the stream of fetched items and filter out items we've sent
 		// previously. Send the remaining items.
 		//
-		// Sending is done synchronously so that items will arrive at the SMTP
-		// server in order. However, this creates a performance bottleneck.
+		// In digest mode there's only ever one outgoing message, so sending
+		// stays on this goroutine. Otherwise each feed's items are handed
+		// off to a pool of config.NumSenders mailer connections: one
+		// goroutine per feed drains that feed's own ordered task list
+		// against a pooled connection, so items within a feed stay in
+		// publish order while different feeds send in parallel. Bolt
+		// transactions aren't goroutine-safe, so only this goroutine ever
+		// touches itemBucket or hashBucket--sender goroutines report back
+		// over writeQueue instead of writing directly.
 
 		type fetchItem struct {
 			feedLink string
@@ -236,16 +409,65 @@ func commandRun(config *Config) error {
 
 		allFetchedItems := make(map[fetchItem]string)
 
-		mailer, err := newMailer(config)
-		if err != nil {
-			return err
+		var digestTmpl *template.Template
+		digestFeeds := make(map[string]*DigestFeed)
+		var digestFeedOrder []string
+
+		var digestMailer mailer
+
+		if config.Digest.Enabled {
+			var err error
+			digestTmpl, err = loadDigestTemplate(config.Digest.TemplatePath)
+			if err != nil {
+				return fmt.Errorf("Failed to load digest template: %v", err)
+			}
+
+			digestMailer, err = newMailer(config)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err := digestMailer.Close(); err != nil {
+					panic(err)
+				}
+			}()
 		}
 
-		defer func() {
-			if err := mailer.Close(); err != nil {
-				panic(err)
+		type sendTask struct {
+			item *gofeed.Item
+			guid []byte
+			hash []byte
+		}
+
+		type sendResult struct {
+			feedLink string
+			guid     []byte
+			hash     []byte
+			pubDate  time.Time
+		}
+
+		mailerPool := make(chan mailer, config.NumSenders)
+		var senderGroup sync.WaitGroup
+		writeQueue := make(chan *sendResult, config.NumSenders*4)
+		sendErr := make(chan error, 1)
+
+		if !config.Digest.Enabled {
+			for i := 0; i < config.NumSenders; i++ {
+				m, err := newMailer(config)
+				if err != nil {
+					return err
+				}
+				mailerPool <- m
 			}
-		}()
+			defer func() {
+				close(mailerPool)
+				for m := range mailerPool {
+					if err := m.Close(); err != nil {
+						panic(err)
+					}
+				}
+			}()
+		}
 
 		for fetch := range fetchOutQueue {
 
@@ -259,51 +481,216 @@ func commandRun(config *Config) error {
 				return fmt.Errorf("Feed item bucket does not exist in database (feed: %q)", fetch.feedLink)
 			}
 
+			// The hash bucket may not exist yet for feeds added before
+			// content-hash dedup existed, so create it lazily here instead
+			// of requiring a one-off database migration.
+			hashBucket, err := b.CreateBucketIfNotExists([]byte("hash"))
+			if err != nil {
+				return fmt.Errorf("Failed to create feed hash bucket (feed: %q): %v", fetch.feedLink, err)
+			}
+
+			meta, err := feedMetaFromBytes(b.Get([]byte("meta")))
+			if err != nil {
+				return fmt.Errorf("Failed to read feed meta (feed: %q): %v", fetch.feedLink, err)
+			}
+
+			meta.ETag = fetch.etag
+			meta.LastModified = fetch.lastModified
+			meta.LastFetchTime = fetch.fetchTime
+			meta.LastFetchStatus = fetch.fetchStatus
+			meta.ConsecutiveFailures = fetch.consecutiveFailures
+
+			v, err := meta.toBytes()
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte("meta"), v); err != nil {
+				return fmt.Errorf("Failed to update feed meta (feed: %q): %v", fetch.feedLink, err)
+			}
+
+			if fetch.err != nil {
+				log(LOG_0, "*** Failed to fetch %v: %v.", fetch.feedLink, fetch.err)
+				continue
+			}
+
+			if fetch.fetchStatus == "not-modified" {
+				log(LOG_1, "Not modified: %v", fetch.feedLink)
+				continue
+			}
+
+			if meta.Title != "" {
+				fetch.feed.Title = meta.Title
+			}
+
 			if 0 == len(fetch.feed.Items) {
 				log(LOG_1, "!!! Got zero items for %v", fetch.feedLink)
 				continue
 			}
 
+			var tasks []*sendTask
+			sentThisRun := 0
+
 			for _, item := range fetch.feed.Items {
 
 				guid := itemGUID(item)
+				hash := itemContentHash(item)
 
 				allFetchedItems[fetchItem{
 					feedLink: fetch.feedLink,
 					itemGUID: string(guid),
 				}] = item.Title
 
-				v := itemBucket.Get(guid)
-				if v != nil {
-					if _, err := feedItemFromBytes(v); err != nil {
+				seen, err := isItemSeen(config, itemBucket, hashBucket, guid, hash)
+				if err != nil {
+					return err
+				}
+
+				if seen {
+					log(LOG_2, "Skip: %v (%q)", fetch.feedLink, item.Title)
+					continue
+				}
+
+				matches, err := itemMatchesFeedFilters(meta, item)
+				if err != nil {
+					return err
+				}
+
+				if !matches {
+					log(LOG_2, "Filter: %v (%q)", fetch.feedLink, item.Title)
+					if err := putFeedItem(itemBucket, hashBucket, guid, hash, itemPubDate(item)); err != nil {
 						return err
 					}
-					log(LOG_2, "Skip: %v (%q)", fetch.feedLink, item.Title)
 					continue
 				}
 
-				log(LOG_2, "Send: %v (%q)", fetch.feedLink, item.Title)
+				if 0 < meta.MinPubAge && time.Since(itemPubDate(item)) < meta.MinPubAge {
+					log(LOG_2, "Hold: %v (%q)", fetch.feedLink, item.Title)
+					continue
+				}
+
+				if 0 < meta.MaxItemsPerRun && meta.MaxItemsPerRun <= sentThisRun {
+					log(LOG_2, "Rate-limit: %v (%q)", fetch.feedLink, item.Title)
+					continue
+				}
 
-				if err := mailer.send(fetch.feed, item); err != nil {
+				if err := rewriteItemBody(meta, item); err != nil {
 					return err
 				}
 
-				pubDate := time.Now()
-				if item.PublishedParsed != nil {
-					pubDate = *item.PublishedParsed
+				sentThisRun++
+
+				if config.Digest.Enabled {
+
+					digestFeed, ok := digestFeeds[fetch.feedLink]
+					if !ok {
+						digestFeed = &DigestFeed{Title: fetch.feed.Title, Link: fetch.feedLink}
+						digestFeeds[fetch.feedLink] = digestFeed
+						digestFeedOrder = append(digestFeedOrder, fetch.feedLink)
+					}
+					if 0 < config.Digest.MaxItems && config.Digest.MaxItems <= len(digestFeed.Items) {
+						// Overflowed this feed's digest cap--don't mark it
+						// seen, so it rolls over and gets another chance in
+						// a future digest instead of being silently lost.
+						log(LOG_2, "Digest overflow: %v (%q)", fetch.feedLink, item.Title)
+						continue
+					}
+
+					digestFeed.Items = append(digestFeed.Items, newDigestItem(item))
+
+					if err := putFeedItem(itemBucket, hashBucket, guid, hash, itemPubDate(item)); err != nil {
+						return err
+					}
+					continue
 				}
-				f := FeedItem{
-					PubDate: pubDate,
+
+				tasks = append(tasks, &sendTask{item: item, guid: guid, hash: hash})
+			}
+
+			if config.Digest.Enabled || 0 == len(tasks) {
+				continue
+			}
+
+			log(LOG_1, "Dispatch: %v (%v items)", fetch.feedLink, len(tasks))
+
+			feedLink := fetch.feedLink
+			feed := fetch.feed
+			recipient := meta.Recipient
+
+			senderGroup.Add(1)
+			go func() {
+				defer senderGroup.Done()
+
+				m := <-mailerPool
+				defer func() { mailerPool <- m }()
+
+				for _, task := range tasks {
+					log(LOG_2, "Send: %v (%q)", feedLink, task.item.Title)
+
+					if err := sendWithRetry(m, feed, task.item, recipient, config); err != nil {
+						// Log unconditionally--sendErr only has room to
+						// surface the first failure as commandRun's return
+						// value, so without this any other feed's failure
+						// in the same run would otherwise vanish silently.
+						log(LOG_0, "*** Failed to send %v (%q): %v.", feedLink, task.item.Title, err)
+						select {
+						case sendErr <- err:
+						default:
+						}
+						return
+					}
+
+					writeQueue <- &sendResult{
+						feedLink: feedLink,
+						guid:     task.guid,
+						hash:     task.hash,
+						pubDate:  itemPubDate(task.item),
+					}
 				}
+			}()
+		}
 
-				v, err := f.toBytes()
-				if err != nil {
+		if !config.Digest.Enabled {
+
+			go func() {
+				senderGroup.Wait()
+				close(writeQueue)
+			}()
+
+			for res := range writeQueue {
+				b := feedBucket.Bucket([]byte(res.feedLink))
+				if b == nil {
+					return fmt.Errorf("Feed bucket does not exist in database (feed: %q)", res.feedLink)
+				}
+				itemBucket := b.Bucket([]byte("item"))
+				hashBucket := b.Bucket([]byte("hash"))
+				if err := putFeedItem(itemBucket, hashBucket, res.guid, res.hash, res.pubDate); err != nil {
 					return err
 				}
+			}
 
-				if err := itemBucket.Put(guid, v); err != nil {
-					return fmt.Errorf("Failed to write feed item to database: %v", err)
-				}
+			select {
+			case err := <-sendErr:
+				sendFailure = err
+			default:
+			}
+		}
+
+		if config.Digest.Enabled && 0 < len(digestFeedOrder) {
+
+			var feeds []*DigestFeed
+			for _, feedLink := range digestFeedOrder {
+				feeds = append(feeds, digestFeeds[feedLink])
+			}
+
+			body, err := renderDigest(digestTmpl, feeds)
+			if err != nil {
+				return err
+			}
+
+			log(LOG_1, "Send digest: %v feeds", len(feeds))
+
+			if err := digestMailer.sendDigest("RSS digest", body); err != nil {
+				return err
 			}
 		}
 
@@ -357,5 +744,9 @@ func commandRun(config *Config) error {
 		*/
 
 		return nil
-	})
+	}); err != nil {
+		return err
+	}
+
+	return sendFailure
 }
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/mmcdole/gofeed"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestItemContentHash(t *testing.T) {
+
+	a := &gofeed.Item{Title: " Hello ", Link: "http://example.com/a", Description: "desc"}
+	b := &gofeed.Item{Title: "Hello", Link: "http://example.com/a", Description: "desc"}
+	if string(itemContentHash(a)) != string(itemContentHash(b)) {
+		t.Error("Expected equal hashes for items differing only by surrounding whitespace")
+	}
+
+	c := &gofeed.Item{Title: "Hello", Link: "http://example.com/a", Description: "different"}
+	if string(itemContentHash(a)) == string(itemContentHash(c)) {
+		t.Error("Expected different hashes for items with different descriptions")
+	}
+}
+
+func TestIsItemSeenDedupModes(t *testing.T) {
+
+	tmpdir := mustCreateTempDir()
+	defer mustRemoveTempDir(tmpdir)
+
+	db, err := bolt.Open(filepath.Join(tmpdir, "test.db"), 0666, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	guid := []byte("guid-1")
+	hash := []byte("hash-1")
+	otherGUID := []byte("guid-2")
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+
+		itemBucket, err := tx.CreateBucket([]byte("item"))
+		if err != nil {
+			return err
+		}
+		hashBucket, err := tx.CreateBucket([]byte("hash"))
+		if err != nil {
+			return err
+		}
+
+		if err := putFeedItem(itemBucket, hashBucket, guid, hash, time.Now()); err != nil {
+			return err
+		}
+
+		for _, mode := range []string{"guid", "hash", "both"} {
+			config := &Config{DedupMode: mode}
+
+			seen, err := isItemSeen(config, itemBucket, hashBucket, guid, hash)
+			if err != nil {
+				return err
+			}
+			if !seen {
+				t.Errorf("DedupMode %q: expected already-recorded item (same GUID) to be seen", mode)
+			}
+
+			// A new GUID sharing the known content hash is only "seen"
+			// under hash-based dedup modes.
+			seen, err = isItemSeen(config, itemBucket, hashBucket, otherGUID, hash)
+			if err != nil {
+				return err
+			}
+			wantSeenByHash := mode == "hash" || mode == "both"
+			if seen != wantSeenByHash {
+				t.Errorf("DedupMode %q: new GUID with known content hash: got seen=%v, want %v", mode, seen, wantSeenByHash)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestItemMatchesFeedFilters(t *testing.T) {
+
+	item := &gofeed.Item{Title: "Breaking News", Description: "All about Go programming"}
+
+	cases := []struct {
+		name    string
+		meta    *FeedMeta
+		matches bool
+	}{
+		{"no filters", &FeedMeta{}, true},
+		{"include matches", &FeedMeta{IncludeRegex: "Go"}, true},
+		{"include does not match", &FeedMeta{IncludeRegex: "Rust"}, false},
+		{"exclude matches", &FeedMeta{ExcludeRegex: "Breaking"}, false},
+		{"exclude does not match", &FeedMeta{ExcludeRegex: "Rust"}, true},
+	}
+
+	for _, c := range cases {
+		matches, err := itemMatchesFeedFilters(c.meta, item)
+		if err != nil {
+			t.Fatalf("%v: %v", c.name, err)
+		}
+		if matches != c.matches {
+			t.Errorf("%v: got matches=%v, want %v", c.name, matches, c.matches)
+		}
+	}
+}
+
+func TestRewriteItemBody(t *testing.T) {
+
+	tmpdir := mustCreateTempDir()
+	defer mustRemoveTempDir(tmpdir)
+
+	path := filepath.Join(tmpdir, "rewrite.tmpl")
+	if err := ioutil.WriteFile(path, []byte("Rewritten: {{.Title}}"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	item := &gofeed.Item{Title: "Original", Description: "original body"}
+	meta := &FeedMeta{RewriteTemplatePath: path}
+
+	if err := rewriteItemBody(meta, item); err != nil {
+		t.Fatal(err)
+	}
+
+	if item.Description != "Rewritten: Original" {
+		t.Errorf("Got description %q, want %q", item.Description, "Rewritten: Original")
+	}
+
+	// No template configured: description is left untouched.
+
+	item2 := &gofeed.Item{Title: "Other", Description: "untouched"}
+	if err := rewriteItemBody(&FeedMeta{}, item2); err != nil {
+		t.Fatal(err)
+	}
+	if item2.Description != "untouched" {
+		t.Errorf("Expected description to be left untouched, got %q", item2.Description)
+	}
+}
@@ -8,11 +8,25 @@ import (
 
 type Config struct {
 	Recipient       string
+	Delivery        string // "smtp" (default) or "imap"
+	DedupMode       string // "guid" (default), "hash", or "both"
 	SmtpServer      string
 	SmtpUser        string
 	SmtpPassword    string
+	ImapServer      string
+	ImapUser        string
+	ImapPassword    string
+	ImapFolder      string // root folder under which per-feed folders are created, e.g. "INBOX/Feeds"
+	ImapNoTLS       bool   // connect with STARTTLS instead of implicit TLS
+	Digest          DigestConfig
+	NumFetchers     int           // concurrent feed fetchers, default 20
+	NumSenders      int           // concurrent mailer connections, default 5
+	SendRetries     int           // retries per item on transient send errors, default 3
+	SendBackoff     time.Duration // initial retry backoff, doubled on each attempt, default 1s
 	DatabasePath    string
 	DatabaseTimeout time.Duration
+	UserAgent       string        // sent as the HTTP User-Agent header when fetching feeds
+	FetchTimeout    time.Duration // per-feed HTTP timeout, default 30s
 }
 
 func loadConfig() (*Config, error) {
@@ -28,7 +42,44 @@ func loadConfig() (*Config, error) {
 		config.DatabasePath = "rss2email.db"
 	}
 
+	if config.ImapFolder == "" {
+		config.ImapFolder = "INBOX/Feeds"
+	}
+
+	switch config.DedupMode {
+	case "":
+		config.DedupMode = "guid"
+	case "guid", "hash", "both":
+		// Valid as given.
+	default:
+		return nil, fmt.Errorf("Unknown dedup mode (dedupMode: %q)", config.DedupMode)
+	}
+
+	if config.NumFetchers <= 0 {
+		config.NumFetchers = 20
+	}
+
+	if config.NumSenders <= 0 {
+		config.NumSenders = 5
+	}
+
+	if config.SendRetries <= 0 {
+		config.SendRetries = 3
+	}
+
+	if config.SendBackoff <= 0 {
+		config.SendBackoff = time.Second
+	}
+
 	config.DatabaseTimeout = time.Second
 
+	if config.UserAgent == "" {
+		config.UserAgent = "rss2email/1.0 (+https://github.com/cmbrandenburg/rss2email)"
+	}
+
+	if config.FetchTimeout <= 0 {
+		config.FetchTimeout = 30 * time.Second
+	}
+
 	return &config, nil
 }
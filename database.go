@@ -69,6 +69,30 @@ func openDatabaseImpl(config *Config) (*bolt.DB, error) {
 type FeedMeta struct {
 	Link          string
 	LastBuildDate time.Time
+
+	// Per-feed configuration. These fields are absent (zero value) on
+	// records written before this feature existed; gob leaves them as
+	// their zero value when decoding such records, so old databases keep
+	// working without a migration step--they just behave as before,
+	// with no overrides or filtering.
+
+	Title               string // overrides the feed's own title, e.g. for the "From" header
+	Recipient           string // overrides config.Recipient for this feed
+	IncludeRegex        string // item is skipped unless title+description matches
+	ExcludeRegex        string // item is skipped if title+description matches
+	MinPubAge           time.Duration
+	MaxItemsPerRun      int    // 0 means unlimited
+	RewriteTemplatePath string // text/template applied to each item's description before sending
+	Category            string // OPML outline group this feed was imported into, if any
+
+	// Conditional-GET caching, so a run that finds nothing new costs the
+	// feed's server one cheap 304 response instead of a full fetch.
+
+	ETag                string    // value of the feed server's last ETag response header, if any
+	LastModified        string    // value of the feed server's last Last-Modified response header, if any
+	LastFetchTime       time.Time // when this feed was last attempted, used to gate fetch backoff
+	LastFetchStatus     string    // "ok", "not-modified", or "error: <details>" from the last attempt
+	ConsecutiveFailures int       // consecutive failed fetch attempts; gates exponential backoff
 }
 
 func feedMetaFromBytes(v []byte) (*FeedMeta, error) {
@@ -92,6 +116,13 @@ func (f *FeedMeta) toBytes() ([]byte, error) {
 
 type FeedItem struct {
 	PubDate time.Time
+
+	// ContentHash is the SHA-256 hash of the item's normalized title, link
+	// and description. It's absent (zero-length) on records written before
+	// this field existed; gob leaves it as its zero value when decoding
+	// such records, so old databases keep working without a migration
+	// step--they just don't get hash-based dedup for their existing items.
+	ContentHash []byte
 }
 
 func feedItemFromBytes(v []byte) (*FeedItem, error) {
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mmcdole/gofeed"
+	"html/template"
+	"time"
+)
+
+// DigestConfig controls digest mode, in which all new items gathered during
+// a run are collected into a single multi-feed email instead of one email
+// per item.
+type DigestConfig struct {
+	Enabled bool
+	// Scheduling which runs produce a digest (e.g. "daily") is left to
+	// whatever invokes "rss2email run"--cron, systemd timers, etc.--rather
+	// than duplicated here; every invocation with Enabled set produces one.
+	MaxItems     int    // maximum items per feed included in the digest, 0 means unlimited
+	TemplatePath string // path to an html/template file; built-in template used if empty
+}
+
+// DigestItem is a single feed item as seen by a digest template.
+type DigestItem struct {
+	Title       string
+	Link        string
+	Published   time.Time
+	Description template.HTML
+}
+
+// DigestFeed groups the new items gathered for one feed during a run, for
+// rendering into a digest template.
+type DigestFeed struct {
+	Title string
+	Link  string
+	Items []DigestItem
+}
+
+const defaultDigestTemplate = `<html><body>
+{{range .}}
+<h2>{{.Title}}</h2>
+<ul>
+{{range .Items}}
+<li><a href="{{.Link}}">{{.Title}}</a> ({{.Published.Format "2006-01-02"}})<br>{{.Description}}</li>
+{{end}}
+</ul>
+{{end}}
+</body></html>`
+
+func loadDigestTemplate(path string) (*template.Template, error) {
+	if path == "" {
+		return template.New("digest").Parse(defaultDigestTemplate)
+	}
+	return template.ParseFiles(path)
+}
+
+func renderDigest(tmpl *template.Template, feeds []*DigestFeed) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, feeds); err != nil {
+		return nil, fmt.Errorf("Failed to render digest template: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func newDigestItem(item *gofeed.Item) DigestItem {
+	pubDate := time.Now()
+	if item.PublishedParsed != nil {
+		pubDate = *item.PublishedParsed
+	}
+	return DigestItem{
+		Title:       item.Title,
+		Link:        item.Link,
+		Published:   pubDate,
+		Description: template.HTML(item.Description),
+	}
+}
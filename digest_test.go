@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderDigest(t *testing.T) {
+
+	tmpl, err := loadDigestTemplate("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feeds := []*DigestFeed{
+		{
+			Title: "Feed One",
+			Link:  "http://example.com/feed",
+			Items: []DigestItem{
+				{Title: "Item A", Link: "http://example.com/a", Published: time.Now(), Description: "<b>hi</b>"},
+			},
+		},
+	}
+
+	body, err := renderDigest(tmpl, feeds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rendered := string(body)
+	if !strings.Contains(rendered, "Feed One") {
+		t.Errorf("Expected rendered digest to contain the feed title, got: %v", rendered)
+	}
+	if !strings.Contains(rendered, "Item A") {
+		t.Errorf("Expected rendered digest to contain the item title, got: %v", rendered)
+	}
+	if !strings.Contains(rendered, "<b>hi</b>") {
+		t.Error("Expected item description to be rendered as raw HTML, not escaped")
+	}
+}
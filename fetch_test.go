@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFetchBackoffDelay(t *testing.T) {
+
+	if d := fetchBackoffDelay(0); d != 0 {
+		t.Errorf("Got %v, want 0 for zero consecutive failures", d)
+	}
+
+	if d := fetchBackoffDelay(1); d != time.Minute {
+		t.Errorf("Got %v, want %v after the first failure", d, time.Minute)
+	}
+
+	if d := fetchBackoffDelay(2); d != 2*time.Minute {
+		t.Errorf("Got %v, want %v after the second consecutive failure", d, 2*time.Minute)
+	}
+
+	if d := fetchBackoffDelay(100); d != 24*time.Hour {
+		t.Errorf("Got %v, want the one-day ceiling after many consecutive failures", d)
+	}
+}
+
+func TestFetchFeedConditionalGET(t *testing.T) {
+
+	const feedBody = `<rss version="2.0"><channel><title>Test</title></channel></rss>`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == "etag-1" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", "etag-1")
+		w.Write([]byte(feedBody))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Timeout: time.Second}
+
+	result := fetchFeed(client, "rss2email-test", server.URL, &FeedMeta{})
+	if result.err != nil {
+		t.Fatal(result.err)
+	}
+	if result.fetchStatus != "ok" {
+		t.Errorf("Got fetchStatus %q, want %q", result.fetchStatus, "ok")
+	}
+	if result.etag != "etag-1" {
+		t.Errorf("Got etag %q, want %q", result.etag, "etag-1")
+	}
+	if result.feed == nil {
+		t.Fatal("Expected a parsed feed on a 200 response")
+	}
+
+	// A second fetch with the cached ETag should come back as a 304, with
+	// no feed and a reset failure count.
+
+	result2 := fetchFeed(client, "rss2email-test", server.URL, &FeedMeta{ETag: result.etag})
+	if result2.err != nil {
+		t.Fatal(result2.err)
+	}
+	if result2.fetchStatus != "not-modified" {
+		t.Errorf("Got fetchStatus %q, want %q", result2.fetchStatus, "not-modified")
+	}
+	if result2.feed != nil {
+		t.Error("Expected no feed on a 304 response")
+	}
+	if result2.consecutiveFailures != 0 {
+		t.Errorf("Got consecutiveFailures %v, want 0", result2.consecutiveFailures)
+	}
+}
+
+func TestFetchFeedError(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Timeout: time.Second}
+
+	result := fetchFeed(client, "rss2email-test", server.URL, &FeedMeta{ConsecutiveFailures: 2})
+	if result.err == nil {
+		t.Fatal("Expected an error for a non-200, non-304 response")
+	}
+	if result.consecutiveFailures != 3 {
+		t.Errorf("Got consecutiveFailures %v, want 3", result.consecutiveFailures)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/mmcdole/gofeed"
+	"html"
+	"net/smtp"
+	"strings"
+)
+
+const DEBUG_SEND_TEST = false
+const DEBUG_NO_SEND = false
+
+// mailer delivers a feed item to the user. The two implementations are
+// smtpMailer, which relays the item as an outgoing email, and imapMailer,
+// which appends the item directly into an IMAP mailbox.
+type mailer interface {
+	// recipient, if non-empty, overrides config.Recipient for this item.
+	// imapMailer delivers by mailbox and ignores it.
+	send(feed *gofeed.Feed, item *gofeed.Item, recipient string) error
+	sendDigest(subject string, htmlBody []byte) error
+	Close() error
+}
+
+func newMailer(config *Config) (mailer, error) {
+
+	if DEBUG_NO_SEND {
+		return &noopMailer{}, nil
+	}
+
+	switch config.Delivery {
+	case "", "smtp":
+		return newSmtpMailer(config)
+	case "imap":
+		return newImapMailer(config)
+	default:
+		return nil, fmt.Errorf("Unknown delivery mode (delivery: %q)", config.Delivery)
+	}
+}
+
+func formatMessage(config *Config, feed *gofeed.Feed, item *gofeed.Item, recipient string) []byte {
+
+	if recipient == "" {
+		recipient = config.Recipient
+	}
+
+	var parts []string
+	parts = append(parts, fmt.Sprintf("To: %v", recipient))
+	parts = append(parts, fmt.Sprintf("From: %v <%v>", feed.Title, config.messageFrom()))
+	text := ""
+	if DEBUG_SEND_TEST {
+		text = "(rss2email-test) "
+	}
+	parts = append(parts, fmt.Sprintf("Subject: %v%v", text, item.Title))
+	parts = append(parts, "Content-Type: text/html")
+	parts = append(parts, "")
+	parts = append(parts, fmt.Sprintf(`<h1><a href="%v">%v</a></h1>%v<p><a href="%v">%v</a></p>`,
+		html.EscapeString(item.Link),
+		html.EscapeString(item.Title),
+		item.Description,
+		html.EscapeString(item.Link),
+		html.EscapeString(item.Link)))
+
+	return []byte(strings.Join(parts, "\r\n"))
+}
+
+// messageFrom returns the address used for the "From" header, regardless of
+// which delivery backend is in use.
+func (c *Config) messageFrom() string {
+	if c.SmtpUser != "" {
+		return c.SmtpUser
+	}
+	return c.ImapUser
+}
+
+func formatDigestMessage(config *Config, subject string, htmlBody []byte) []byte {
+
+	var parts []string
+	parts = append(parts, fmt.Sprintf("To: %v", config.Recipient))
+	parts = append(parts, fmt.Sprintf("From: rss2email <%v>", config.messageFrom()))
+	parts = append(parts, fmt.Sprintf("Subject: %v", subject))
+	parts = append(parts, "Content-Type: text/html")
+	parts = append(parts, "")
+	parts = append(parts, string(htmlBody))
+
+	return []byte(strings.Join(parts, "\r\n"))
+}
+
+type noopMailer struct{}
+
+func (m *noopMailer) send(feed *gofeed.Feed, item *gofeed.Item, recipient string) error {
+	return nil
+}
+func (m *noopMailer) sendDigest(subject string, htmlBody []byte) error { return nil }
+func (m *noopMailer) Close() error                                     { return nil }
+
+type smtpMailer struct {
+	client *smtp.Client
+	config *Config
+}
+
+func newSmtpMailer(config *Config) (*smtpMailer, error) {
+
+	c, err := smtp.Dial(config.SmtpServer)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to SMTP server (server: %q): %v", config.SmtpServer, err)
+	}
+
+	tlsConfig := tls.Config{
+		ServerName: strings.Split(config.SmtpServer, ":")[0],
+	}
+
+	if err := c.StartTLS(&tlsConfig); err != nil {
+		return nil, fmt.Errorf("Failed to start TLS with SMTP server (server: %q): %v",
+			config.SmtpServer, err)
+	}
+
+	auth := smtp.PlainAuth("", config.SmtpUser, config.SmtpPassword, strings.Split(config.SmtpServer, ":")[0])
+
+	if err := c.Auth(auth); err != nil {
+		return nil, fmt.Errorf("Failed to authenticate with SMTP server (server: %q, username: %q, password: *****): %v",
+			config.SmtpServer, config.SmtpUser, err)
+	}
+
+	return &smtpMailer{
+		client: c,
+		config: config,
+	}, nil
+}
+
+func (m *smtpMailer) Close() error {
+	return m.client.Close()
+}
+
+func (m *smtpMailer) send(feed *gofeed.Feed, item *gofeed.Item, recipient string) error {
+
+	// FIXME: Need to escape stuff.
+
+	if recipient == "" {
+		recipient = m.config.Recipient
+	}
+
+	return m.deliver(recipient, formatMessage(m.config, feed, item, recipient))
+}
+
+func (m *smtpMailer) sendDigest(subject string, htmlBody []byte) error {
+	return m.deliver(m.config.Recipient, formatDigestMessage(m.config, subject, htmlBody))
+}
+
+func (m *smtpMailer) deliver(recipient string, content []byte) error {
+
+	if err := m.client.Mail(m.config.SmtpUser); err != nil {
+		return fmt.Errorf("Failed to execute SMTP MAIL command: %v", err)
+	}
+
+	if err := m.client.Rcpt(recipient); err != nil {
+		return fmt.Errorf("Failed to execute SMTP RCTP command: %v", err)
+	}
+
+	w, err := m.client.Data()
+	if err != nil {
+		return fmt.Errorf("Failed to execute SMTP DATA command: %v", err)
+	}
+
+	if _, err := w.Write(content); err != nil {
+		return fmt.Errorf("Failed to write content in SMTP DATA command: %v", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("Failed to close SMTP DATA command writer: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/mmcdole/gofeed"
+	"strings"
+	"time"
+)
+
+// imapMailer delivers feed items by APPENDing them as messages into an
+// IMAP folder, rather than relaying them through an SMTP server. This suits
+// users who read RSS feeds from within their mail client and don't want to
+// run an outbound mail relay just for rss2email.
+type imapMailer struct {
+	client *client.Client
+	config *Config
+}
+
+func newImapMailer(config *Config) (*imapMailer, error) {
+
+	tlsConfig := &tls.Config{
+		ServerName: strings.Split(config.ImapServer, ":")[0],
+	}
+
+	var c *client.Client
+	var err error
+	if config.ImapNoTLS {
+		// Connect in plaintext, then upgrade via STARTTLS before any
+		// credentials or feed content cross the wire--ImapNoTLS selects
+		// the handshake, not whether the session ends up encrypted.
+		c, err = client.Dial(config.ImapServer)
+		if err == nil {
+			err = c.StartTLS(tlsConfig)
+		}
+	} else {
+		c, err = client.DialTLS(config.ImapServer, tlsConfig)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to IMAP server (server: %q): %v", config.ImapServer, err)
+	}
+
+	if err := c.Login(config.ImapUser, config.ImapPassword); err != nil {
+		c.Logout()
+		return nil, fmt.Errorf("Failed to authenticate with IMAP server (server: %q, username: %q, password: *****): %v",
+			config.ImapServer, config.ImapUser, err)
+	}
+
+	return &imapMailer{
+		client: c,
+		config: config,
+	}, nil
+}
+
+func (m *imapMailer) Close() error {
+	if err := m.client.Logout(); err != nil {
+		return fmt.Errorf("Failed to log out of IMAP server: %v", err)
+	}
+	return nil
+}
+
+// feedFolder returns the mailbox that items from the given feed should be
+// appended to, e.g. "INBOX/Feeds/My Feed Title", built using the server's
+// own hierarchy delimiter.
+func (m *imapMailer) feedFolder(feedTitle string) (string, error) {
+
+	delim := "/"
+	mailboxes := make(chan *imap.MailboxInfo, 1)
+	done := make(chan error, 1)
+	go func() {
+		// The empty-name special case is what makes List report the
+		// delimiter instead of listing matching mailboxes; querying with
+		// m.config.ImapFolder would return nothing before that folder
+		// exists, leaving delim stuck at its "/" fallback.
+		done <- m.client.List("", "", mailboxes)
+	}()
+	for mbox := range mailboxes {
+		if mbox.Delimiter != "" {
+			delim = mbox.Delimiter
+		}
+	}
+	if err := <-done; err != nil {
+		return "", fmt.Errorf("Failed to query IMAP mailbox hierarchy delimiter: %v", err)
+	}
+
+	sanitizedTitle := strings.ReplaceAll(feedTitle, delim, "-")
+	return strings.Join([]string{m.config.ImapFolder, sanitizedTitle}, delim), nil
+}
+
+func (m *imapMailer) ensureFolder(name string) error {
+
+	mailboxes := make(chan *imap.MailboxInfo, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- m.client.List("", name, mailboxes)
+	}()
+
+	exists := false
+	for mbox := range mailboxes {
+		if mbox.Name == name {
+			exists = true
+		}
+	}
+	if err := <-done; err != nil {
+		return fmt.Errorf("Failed to list IMAP mailboxes (mailbox: %q): %v", name, err)
+	}
+
+	if exists {
+		return nil
+	}
+
+	if err := m.client.Create(name); err != nil {
+		return fmt.Errorf("Failed to create IMAP mailbox (mailbox: %q): %v", name, err)
+	}
+
+	return nil
+}
+
+func (m *imapMailer) send(feed *gofeed.Feed, item *gofeed.Item, recipient string) error {
+
+	folder, err := m.feedFolder(feed.Title)
+	if err != nil {
+		return err
+	}
+
+	if err := m.ensureFolder(folder); err != nil {
+		return err
+	}
+
+	// Delivery is by mailbox, not by address, so a per-feed recipient
+	// override has no effect on IMAP delivery.
+	content := formatMessage(m.config, feed, item, "")
+
+	date := time.Now()
+	if item.PublishedParsed != nil {
+		date = *item.PublishedParsed
+	}
+
+	if err := m.client.Append(folder, []string{imap.SeenFlag}, date, bytes.NewReader(content)); err != nil {
+		return fmt.Errorf("Failed to APPEND message to IMAP mailbox (mailbox: %q): %v", folder, err)
+	}
+
+	return nil
+}
+
+func (m *imapMailer) sendDigest(subject string, htmlBody []byte) error {
+
+	if err := m.ensureFolder(m.config.ImapFolder); err != nil {
+		return err
+	}
+
+	content := formatDigestMessage(m.config, subject, htmlBody)
+
+	if err := m.client.Append(m.config.ImapFolder, []string{imap.SeenFlag}, time.Now(), bytes.NewReader(content)); err != nil {
+		return fmt.Errorf("Failed to APPEND digest message to IMAP mailbox (mailbox: %q): %v", m.config.ImapFolder, err)
+	}
+
+	return nil
+}
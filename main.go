@@ -15,6 +15,14 @@ func main() {
 
 	add := app.Command("add", "Add feed to database")
 	addURL := add.Arg("URL", "Feed URL").Required().String()
+	addTitle := add.Flag("title", "Override the feed's own title").String()
+	addRecipient := add.Flag("recipient", "Override the configured recipient for this feed").String()
+	addIncludeRegex := add.Flag("include", "Only send items whose title or description matches this regex").String()
+	addExcludeRegex := add.Flag("exclude", "Never send items whose title or description matches this regex").String()
+	addMinPubAge := add.Flag("min-pub-age", "Hold items back until they're at least this old").Default("0s").Duration()
+	addMaxItemsPerRun := add.Flag("max-items-per-run", "Cap how many items of this feed are sent per run (0 means unlimited)").Default("0").Int()
+	addRewriteTemplatePath := add.Flag("rewrite-template", "Path to a text/template file applied to each item's description").String()
+	addCategory := add.Flag("category", "OPML outline group to file this feed under on export").String()
 
 	createDatabase := app.Command("create-database", "Create new database")
 
@@ -25,6 +33,12 @@ func main() {
 
 	run := app.Command("run", "Fetch feeds and send email")
 
+	importOPML := app.Command("import-opml", "Add feeds from an OPML file")
+	importOPMLPath := importOPML.Arg("PATH", "OPML file path").Required().String()
+
+	exportOPML := app.Command("export-opml", "Write all feeds to an OPML file")
+	exportOPMLPath := exportOPML.Arg("PATH", "OPML file path").Required().String()
+
 	// Everything is wrapped in a top-level error handler.
 
 	if err := func() error {
@@ -34,7 +48,16 @@ func main() {
 			if err != nil {
 				return err
 			}
-			return commandAdd(config, *addURL)
+			return commandAdd(config, *addURL, &FeedOptions{
+				Title:               *addTitle,
+				Recipient:           *addRecipient,
+				IncludeRegex:        *addIncludeRegex,
+				ExcludeRegex:        *addExcludeRegex,
+				MinPubAge:           *addMinPubAge,
+				MaxItemsPerRun:      *addMaxItemsPerRun,
+				RewriteTemplatePath: *addRewriteTemplatePath,
+				Category:            *addCategory,
+			})
 		case createDatabase.FullCommand():
 			config, err := loadConfig()
 			if err != nil {
@@ -59,6 +82,18 @@ func main() {
 				return err
 			}
 			return commandRun(config)
+		case importOPML.FullCommand():
+			config, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			return commandImportOPML(config, *importOPMLPath)
+		case exportOPML.FullCommand():
+			config, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			return commandExportOPML(config, *exportOPMLPath)
 		default:
 			panic("Unknown command-line command")
 		}